@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/bketelsen/golo"
+)
+
+// build.go layers a content-addressed cache and a worker pool in front of
+// golo.BuildPackages. Each source package gets a key derived from its file
+// contents, its resolved imports' keys, GOOS/GOARCH/build tags and the
+// toolchain version. Every package is pointed at its own archive path,
+// .golo/pkg/<key>/pkg.a, via build.Package.PkgObj before it's built, so a
+// key only counts as cached once that exact archive exists on disk - not
+// merely because the cache directory does. A package only starts compiling
+// once every import of its that's also being built here has finished, so
+// the worker pool still parallelizes independent packages without letting a
+// dependent race ahead of its own dependency.
+
+// buildFunc invokes the underlying compiler/linker; it's a var so tests can
+// stub it out without a real golo toolchain.
+var buildFunc = golo.BuildPackages
+
+// maxWorkers bounds how many packages buildPackages compiles at once; a var
+// so tests can exercise concurrency without depending on the host's core
+// count.
+var maxWorkers = runtime.NumCPU
+
+// buildPackages computes cache keys for srcs, builds whatever isn't already
+// cached, and returns a completion closure in the same shape as
+// golo.BuildPackages.
+func buildPackages(ctx *golo.Context, tags []string, srcs []*build.Package) (func() error, error) {
+	byPath := make(map[string]*build.Package, len(srcs))
+	for _, src := range srcs {
+		byPath[src.ImportPath] = src
+	}
+
+	keys := make(map[string]string, len(srcs))
+	var keyOf func(path string) string
+	keyOf = func(path string) string {
+		if k, ok := keys[path]; ok {
+			return k
+		}
+		src := byPath[path]
+		if src == nil {
+			// not one of ours (already resolved elsewhere); key on the
+			// import path alone so it still participates in the hash.
+			return path
+		}
+		h := sha1.New()
+		fmt.Fprintf(h, "os=%s arch=%s tags=%v go=%s\n", ctx.GOOS, ctx.GOARCH, tags, runtime.Version())
+		for _, name := range sortedGoFiles(src) {
+			hashFile(h, filepath.Join(src.Dir, name))
+		}
+		imports := append([]string(nil), src.Imports...)
+		sort.Strings(imports)
+		for _, imp := range imports {
+			io.WriteString(h, keyOf(imp))
+		}
+		key := fmt.Sprintf("%x", h.Sum(nil))
+		keys[path] = key
+		return key
+	}
+
+	type job struct {
+		src  *build.Package
+		key  string
+		dir  string
+		done chan struct{}
+	}
+
+	var pending []*job
+	byImport := make(map[string]*job, len(srcs))
+	for _, src := range srcs {
+		key := keyOf(src.ImportPath)
+		dir := filepath.Join(ctx.Pkgdir, key)
+		if cached(archivePath(dir)) {
+			reportf("cache hit for %s (%s)\n", src.ImportPath, key)
+			continue
+		}
+		reportf("building %s (%s)\n", src.ImportPath, key)
+		j := &job{src: src, key: key, dir: dir, done: make(chan struct{})}
+		pending = append(pending, j)
+		byImport[src.ImportPath] = j
+	}
+
+	if len(pending) == 0 {
+		return func() error { return nil }, nil
+	}
+
+	sem := make(chan struct{}, maxWorkers())
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		fns  []func() error
+	)
+	for _, j := range pending {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			defer close(j.done)
+
+			// Only run once every import of ours that's also being built
+			// here has finished, so this package never compiles against a
+			// dependency's missing or partial archive. Waiting happens
+			// before the semaphore is taken, so a dependency queued behind
+			// a busy worker pool can still make progress.
+			for _, imp := range j.src.Imports {
+				if dep, ok := byImport[imp]; ok {
+					<-dep.done
+				}
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := os.MkdirAll(j.dir, 0755); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+
+			// Pin this package's Pkgdir to its own cache key and tell it
+			// exactly where to leave the compiled archive, so the next run
+			// can tell a real build apart from an empty cache directory.
+			jctx := *ctx
+			jctx.Pkgdir = j.dir
+			pkgs := jctx.Transform(j.src)
+			archive := archivePath(j.dir)
+			for _, p := range pkgs {
+				p.PkgObj = archive
+			}
+			fn, err := buildFunc(pkgs...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			fns = append(fns, func() error {
+				if err := fn(); err != nil {
+					os.RemoveAll(j.dir)
+					return err
+				}
+				if !cached(archive) {
+					// golo didn't leave an archive behind to reuse next
+					// time; don't pretend this key is now cached.
+					os.RemoveAll(j.dir)
+				}
+				return nil
+			})
+		}(j)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return func() error {
+		for _, fn := range fns {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// archivePath is where a package's compiled archive lives within its cache
+// key directory.
+func archivePath(dir string) string {
+	return filepath.Join(dir, "pkg.a")
+}
+
+// cached reports whether archive is a real, previously built file rather
+// than one golo never got around to writing.
+func cached(archive string) bool {
+	fi, err := os.Stat(archive)
+	return err == nil && !fi.IsDir()
+}
+
+func sortedGoFiles(pkg *build.Package) []string {
+	var files []string
+	files = append(files, pkg.GoFiles...)
+	files = append(files, pkg.CgoFiles...)
+	sort.Strings(files)
+	return files
+}
+
+func hashFile(w io.Writer, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.Copy(w, f)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bketelsen/golo"
+)
+
+// newTestPkg writes a trivial source file under dir/name and returns the
+// *build.Package buildPackages expects, bypassing build.ImportDir so the
+// test doesn't need a real GOPATH/module.
+func newTestPkg(t *testing.T, root, name, importPath string) *build.Package {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := "package " + name + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name+".go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &build.Package{
+		Dir:        dir,
+		ImportPath: importPath,
+		Name:       name,
+		GoFiles:    []string{name + ".go"},
+	}
+}
+
+func TestBuildPackagesCachesSuccessfulBuilds(t *testing.T) {
+	root := t.TempDir()
+	pkg := newTestPkg(t, root, "foo", "example.com/foo")
+	ctx := &golo.Context{GOOS: "linux", GOARCH: "amd64", Pkgdir: filepath.Join(root, ".golo", "pkg")}
+
+	var calls int
+	restore := stubBuildFunc(t, func(pkgs ...*build.Package) (func() error, error) {
+		calls++
+		for _, p := range pkgs {
+			if err := os.WriteFile(p.PkgObj, []byte("archive"), 0644); err != nil {
+				return nil, err
+			}
+		}
+		return func() error { return nil }, nil
+	})
+	defer restore()
+
+	fn, err := buildPackages(ctx, nil, []*build.Package{pkg})
+	if err != nil {
+		t.Fatalf("buildPackages: %v", err)
+	}
+	if err := fn(); err != nil {
+		t.Fatalf("fn(): %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("buildFunc called %d times on a cold cache, want 1", calls)
+	}
+
+	// Rerun with a warm cache: buildFunc must not be invoked again.
+	fn, err = buildPackages(ctx, nil, []*build.Package{pkg})
+	if err != nil {
+		t.Fatalf("buildPackages (warm): %v", err)
+	}
+	if err := fn(); err != nil {
+		t.Fatalf("fn() (warm): %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("buildFunc called %d times on a warm cache, want 1 (no rebuild)", calls)
+	}
+}
+
+func TestBuildPackagesDoesNotCacheAnEmptyDirectory(t *testing.T) {
+	root := t.TempDir()
+	pkg := newTestPkg(t, root, "foo", "example.com/foo")
+	ctx := &golo.Context{GOOS: "linux", GOARCH: "amd64", Pkgdir: filepath.Join(root, ".golo", "pkg")}
+
+	var calls int
+	restore := stubBuildFunc(t, func(pkgs ...*build.Package) (func() error, error) {
+		calls++
+		// Misbehaving build: claims success but never writes PkgObj.
+		return func() error { return nil }, nil
+	})
+	defer restore()
+
+	fn, err := buildPackages(ctx, nil, []*build.Package{pkg})
+	if err != nil {
+		t.Fatalf("buildPackages: %v", err)
+	}
+	if err := fn(); err != nil {
+		t.Fatalf("fn(): %v", err)
+	}
+
+	// With no archive on disk, a rerun must rebuild rather than report a
+	// false cache hit.
+	fn, err = buildPackages(ctx, nil, []*build.Package{pkg})
+	if err != nil {
+		t.Fatalf("buildPackages (rerun): %v", err)
+	}
+	if err := fn(); err != nil {
+		t.Fatalf("fn() (rerun): %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("buildFunc called %d times, want 2 (cache must not trust an empty directory)", calls)
+	}
+}
+
+func TestBuildPackagesWaitsForDependencies(t *testing.T) {
+	root := t.TempDir()
+	a := newTestPkg(t, root, "a", "example.com/a")
+	a.Imports = []string{"example.com/b"}
+	b := newTestPkg(t, root, "b", "example.com/b")
+	ctx := &golo.Context{GOOS: "linux", GOARCH: "amd64", Pkgdir: filepath.Join(root, ".golo", "pkg")}
+
+	// Force enough workers that a and b, if the scheduler let them, really
+	// could run at the same time - independent of how many cores the test
+	// happens to run on.
+	orig := maxWorkers
+	maxWorkers = func() int { return 2 }
+	defer func() { maxWorkers = orig }()
+
+	var bDone int32
+	restore := stubBuildFunc(t, func(pkgs ...*build.Package) (func() error, error) {
+		for _, p := range pkgs {
+			switch p.ImportPath {
+			case "example.com/b":
+				// Make the dependency's compile slow enough that, absent
+				// any ordering, the dependent would race ahead of it.
+				time.Sleep(150 * time.Millisecond)
+				if err := os.WriteFile(p.PkgObj, []byte("archive"), 0644); err != nil {
+					return nil, err
+				}
+				atomic.StoreInt32(&bDone, 1)
+			case "example.com/a":
+				if atomic.LoadInt32(&bDone) == 0 {
+					t.Errorf("example.com/a started building before its import example.com/b finished")
+				}
+				if err := os.WriteFile(p.PkgObj, []byte("archive"), 0644); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return func() error { return nil }, nil
+	})
+	defer restore()
+
+	fn, err := buildPackages(ctx, nil, []*build.Package{a, b})
+	if err != nil {
+		t.Fatalf("buildPackages: %v", err)
+	}
+	if err := fn(); err != nil {
+		t.Fatalf("fn(): %v", err)
+	}
+}
+
+// stubBuildFunc replaces buildFunc for the duration of the test.
+func stubBuildFunc(t *testing.T, f func(pkgs ...*build.Package) (func() error, error)) func() {
+	t.Helper()
+	orig := buildFunc
+	buildFunc = f
+	return func() { buildFunc = orig }
+}
@@ -14,11 +14,13 @@ import (
 	"strings"
 
 	"bitbucket.org/rw_grim/govcs"
+	"golang.org/x/tools/go/vcs"
 
 	"github.com/bketelsen/golo"
 )
 
 var verbose bool
+var offline bool
 
 func report(vals ...interface{}) {
 	if verbose {
@@ -47,7 +49,12 @@ func fatal(arg interface{}, args ...interface{}) {
 
 func main() {
 	pkgptr := flag.String("package", "", "the import path of your package")
+	osptr := flag.String("os", runtime.GOOS, "comma-separated list of target GOOS values")
+	archptr := flag.String("arch", runtime.GOARCH, "comma-separated list of target GOARCH values")
+	tagsptr := flag.String("tags", "", "comma-separated list of build tags")
+	ldflagsptr := flag.String("ldflags", "", "flags to pass to the linker")
 	flag.BoolVar(&verbose, "verbose", false, "verbose output")
+	flag.BoolVar(&offline, "offline", false, "do not fetch missing dependencies over the network")
 	flag.Parse()
 
 	// icky
@@ -64,14 +71,9 @@ func main() {
 	check(err)
 
 	pkgdir := filepath.Join(dir, ".golo", "pkg")
-
-	ctx := &golo.Context{
-		GOOS:    runtime.GOOS,
-		GOARCH:  runtime.GOARCH,
-		Workdir: workdir,
-		Pkgdir:  pkgdir,
-		Bindir:  dir,
-	}
+	tags := splitCSV(*tagsptr)
+	oses := splitCSV(*osptr)
+	arches := splitCSV(*archptr)
 
 	action := "build"
 	var prefix string
@@ -86,32 +88,117 @@ func main() {
 
 	switch action {
 	case "build":
-		report("load local sources")
-		srcs := loadSources(prefix, dir)
-		for _, src := range srcs {
-			reportf("loaded %s (%s)\n", src.ImportPath, src.Name)
-		}
-		report("load dependencies")
-		srcs = loadDependencies(dir, srcs...)
-		pkgs := ctx.Transform(srcs...)
-		for _, p := range pkgs {
-			reportf("package :  %s\n", p.ImportPath)
+		for _, goos := range oses {
+			for _, goarch := range arches {
+				report("building for", goos, goarch)
+
+				bctx := &build.Context{
+					GOOS:       goos,
+					GOARCH:     goarch,
+					GOROOT:     runtime.GOROOT(),
+					GOPATH:     build.Default.GOPATH,
+					Compiler:   build.Default.Compiler,
+					BuildTags:  tags,
+					CgoEnabled: goos == runtime.GOOS && goarch == runtime.GOARCH && build.Default.CgoEnabled,
+				}
+
+				ctx := &golo.Context{
+					GOOS:    goos,
+					GOARCH:  goarch,
+					Workdir: workdir,
+					Pkgdir:  pkgdir,
+					Bindir:  filepath.Join(dir, goos+"_"+goarch),
+					Ldflags: *ldflagsptr,
+				}
+
+				report("load local sources")
+				srcs := loadSources(bctx, prefix, dir)
+				for _, src := range srcs {
+					reportf("loaded %s (%s)\n", src.ImportPath, src.Name)
+				}
+				report("load dependencies")
+				srcs = loadDependencies(bctx, newResolverChain(dir, offline), srcs...)
+				fn, err := buildPackages(ctx, tags, srcs)
+				check(err)
+				check(fn())
+			}
 		}
-		fn, err := golo.BuildPackages(pkgs...)
-		check(err)
-		check(fn())
 	default:
 		fatal("unknown action:", action)
 	}
 }
 
+// splitCSV splits a comma-separated flag value, dropping empty elements.
+func splitCSV(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// guessPackage turns a VCS remote URL into an import path. It understands
+// https://, ssh://, git:// and the SCP-style "git@host:user/repo.git"
+// shorthand, and confirms the result against
+// vcs.RepoRootForImportPath when the host is reachable, falling back to the
+// normalized path otherwise.
 func guessPackage(remote string) (string, error) {
+	importPath, err := normalizeRemote(remote)
+	if err != nil {
+		return "", err
+	}
+	if root, err := vcs.RepoRootForImportPath(importPath, verbose); err == nil {
+		return root.Root, nil
+	}
+	return importPath, nil
+}
+
+// normalizeRemote canonicalizes a VCS remote into a "host/path" import path,
+// stripping credentials, ports and the .git suffix.
+func normalizeRemote(remote string) (string, error) {
+	remote = strings.TrimSuffix(strings.TrimSpace(remote), "/")
+
+	if host, p, ok := parseSCP(remote); ok {
+		return joinHostPath(host, p), nil
+	}
+
 	uri, err := url.Parse(remote)
 	if err != nil {
 		return "", err
 	}
+	if uri.Host == "" {
+		return "", fmt.Errorf("cannot determine host from remote %q", remote)
+	}
+	return joinHostPath(uri.Host, uri.Path), nil
+}
 
-	return uri.Host + uri.Path, nil
+// parseSCP recognizes the SCP-style shorthand git@host:user/repo.git used by
+// SSH remotes that aren't spelled out as ssh://. Anything containing a
+// scheme ("://") is left to url.Parse instead.
+func parseSCP(remote string) (host, path string, ok bool) {
+	if strings.Contains(remote, "://") {
+		return "", "", false
+	}
+	at := strings.Index(remote, "@")
+	colon := strings.Index(remote, ":")
+	if at < 0 || colon < at {
+		return "", "", false
+	}
+	return remote[at+1 : colon], remote[colon+1:], true
+}
+
+// joinHostPath strips the port from host and the .git suffix from p before
+// joining them into an import path.
+func joinHostPath(host, p string) string {
+	if i := strings.Index(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	p = strings.TrimPrefix(p, "/")
+	p = strings.TrimSuffix(p, ".git")
+	return path.Join(host, p)
 }
 
 func cwd() string {
@@ -120,7 +207,7 @@ func cwd() string {
 	return wd
 }
 
-func loadSources(prefix string, dir string) []*build.Package {
+func loadSources(bctx *build.Context, prefix string, dir string) []*build.Package {
 	f, err := os.Open(dir)
 	check(err)
 	files, err := f.Readdir(-1)
@@ -135,11 +222,11 @@ func loadSources(prefix string, dir string) []*build.Package {
 			continue
 		}
 		if fi.IsDir() {
-			srcs = append(srcs, loadSources(path.Join(prefix, name), filepath.Join(dir, name))...)
+			srcs = append(srcs, loadSources(bctx, path.Join(prefix, name), filepath.Join(dir, name))...)
 		}
 	}
 
-	pkg, err := build.ImportDir(dir, 0)
+	pkg, err := bctx.ImportDir(dir, 0)
 	switch err := err.(type) {
 	case nil:
 		// ImportDir does not know the import path for this package
@@ -156,18 +243,13 @@ func loadSources(prefix string, dir string) []*build.Package {
 	return srcs
 }
 
-func loadDependencies(rootdir string, srcs ...*build.Package) []*build.Package {
+func loadDependencies(bctx *build.Context, resolver Resolver, srcs ...*build.Package) []*build.Package {
 	load := func(path string) *build.Package {
-		dir := filepath.Join(runtime.GOROOT(), "src", path)
-		if _, err := os.Stat(dir); err != nil {
-			reportf("Trying vendor directory %s for dependency %sdir. Rootdir: ", dir, path, rootdir)
-			dir = filepath.Join(rootdir, "vendor", path)
-			report("\tChecking", dir)
-			if _, err = os.Stat(dir); err != nil {
-				fatal("cannot resolve path", path, err.Error())
-			}
+		dir, ok := resolver.Resolve(path)
+		if !ok {
+			fatal("cannot resolve path", path)
 		}
-		return importPath(path, dir)
+		return importPath(bctx, path, dir)
 	}
 
 	seen := make(map[string]bool)
@@ -198,26 +280,9 @@ func loadDependencies(rootdir string, srcs ...*build.Package) []*build.Package {
 	return srcs
 }
 
-func register(rootdir, prefix, kind, arg string, next func(string) *build.Package) func(string) *build.Package {
-	dir := cacheDir(rootdir, prefix+kind+"="+arg)
-	report("registered:", prefix, "@", arg)
-	return func(path string) *build.Package {
-		if !strings.HasPrefix(path, prefix) {
-			return next(path)
-		}
-		report("searching", path, "in", prefix, "@", arg)
-		dir := filepath.Join(dir, path)
-		_, err := os.Stat(dir)
-		if os.IsNotExist(err) {
-			check(err)
-		}
-		return importPath(path, dir)
-	}
-}
-
-func importPath(path, dir string) *build.Package {
+func importPath(bctx *build.Context, path, dir string) *build.Package {
 	report("checking import path for ", path, dir)
-	pkg, err := build.ImportDir(dir, 0)
+	pkg, err := bctx.ImportDir(dir, 0)
 	check(err)
 	// ImportDir does not know the import path for this package
 	// but we know the prefix, so fix it.
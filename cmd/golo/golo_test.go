@@ -0,0 +1,98 @@
+package main
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"single", "linux", []string{"linux"}},
+		{"comma-separated", "linux,darwin,windows", []string{"linux", "darwin", "windows"}},
+		{"spaces around commas", " linux , darwin ", []string{"linux", "darwin"}},
+		{"drops empty elements", "linux,,darwin,", []string{"linux", "darwin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitCSV(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitCSV(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("splitCSV(%q)[%d] = %q, want %q", tt.in, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestLoadSourcesHonorsBuildContext confirms loadSources filters GOOS-suffixed
+// files by the *passed-in* build.Context rather than the ambient one, which
+// is what makes cross-compiling for more than one target at once correct.
+func TestLoadSourcesHonorsBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main_linux.go":   "package demo\n\nconst OS = \"linux\"\n",
+		"main_windows.go": "package demo\n\nconst OS = \"windows\"\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, goos := range []string{"linux", "windows"} {
+		t.Run(goos, func(t *testing.T) {
+			bctx := &build.Context{GOOS: goos, GOARCH: "amd64", Compiler: build.Default.Compiler}
+			srcs := loadSources(bctx, "example.com/demo", dir)
+			if len(srcs) != 1 {
+				t.Fatalf("loadSources(GOOS=%s) returned %d packages, want 1", goos, len(srcs))
+			}
+			want := "main_" + goos + ".go"
+			got := srcs[0].GoFiles
+			if len(got) != 1 || got[0] != want {
+				t.Errorf("loadSources(GOOS=%s) GoFiles = %v, want [%s]", goos, got, want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRemote(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		want   string
+	}{
+		{"github https", "https://github.com/bketelsen/golo.git", "github.com/bketelsen/golo"},
+		{"github https no suffix", "https://github.com/bketelsen/golo", "github.com/bketelsen/golo"},
+		{"github scp ssh", "git@github.com:bketelsen/golo.git", "github.com/bketelsen/golo"},
+		{"github ssh scheme", "ssh://git@github.com/bketelsen/golo.git", "github.com/bketelsen/golo"},
+		{"github ssh scheme with port", "ssh://git@github.com:22/bketelsen/golo.git", "github.com/bketelsen/golo"},
+		{"gitlab https", "https://gitlab.com/group/sub/project.git", "gitlab.com/group/sub/project"},
+		{"bitbucket scp ssh", "git@bitbucket.org:rw_grim/govcs.git", "bitbucket.org/rw_grim/govcs"},
+		{"git protocol", "git://git.example.com/team/tool.git", "git.example.com/team/tool"},
+		{"self-hosted gitea scp", "git@gitea.internal.example.com:ops/deploy.git", "gitea.internal.example.com/ops/deploy"},
+		{"self-hosted gogs https with port", "https://gogs.example.com:3000/ops/deploy.git", "gogs.example.com/ops/deploy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeRemote(tt.remote)
+			if err != nil {
+				t.Fatalf("normalizeRemote(%q) returned error: %v", tt.remote, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeRemote(%q) = %q, want %q", tt.remote, got, tt.want)
+			}
+		})
+	}
+}
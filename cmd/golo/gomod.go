@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gomod.go teaches loadDependencies about Go modules. There is no
+// golang.org/x/mod available to this tree, so this is a deliberately
+// minimal, best-effort go.mod/go.sum reader: just enough to resolve an
+// import path to a directory under $GOPATH/pkg/mod, honoring replace
+// directives along the way. Without a go.mod it resolves nothing, leaving
+// the other resolvers in the chain built by newResolverChain to find the
+// package.
+
+// module is a module path/version pair, as it appears in a require or
+// replace directive.
+type module struct {
+	path    string
+	version string
+}
+
+// modFile is the handful of go.mod directives golo cares about.
+type modFile struct {
+	module  string
+	require []module
+	replace map[string]module
+	exclude map[string]bool
+}
+
+// loadModFile parses the go.mod at path. A missing go.mod is not an error;
+// it just means the project doesn't use modules.
+func loadModFile(path string) (*modFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	mf := &modFile{
+		replace: make(map[string]module),
+		exclude: make(map[string]bool),
+	}
+
+	var block string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if block == "" {
+			if strings.HasPrefix(line, "module ") {
+				mf.module = strings.TrimSpace(strings.TrimPrefix(line, "module "))
+				continue
+			}
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) == 2 && strings.TrimSpace(fields[1]) == "(" {
+				block = fields[0]
+				continue
+			}
+		}
+		if line == ")" {
+			block = ""
+			continue
+		}
+		directive, rest := block, line
+		if directive == "" {
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			directive, rest = fields[0], strings.TrimSpace(fields[1])
+		}
+		switch directive {
+		case "require":
+			if m, ok := parseModuleVersion(rest); ok {
+				mf.require = append(mf.require, m)
+			}
+		case "exclude":
+			if m, ok := parseModuleVersion(rest); ok {
+				mf.exclude[m.path+"@"+m.version] = true
+			}
+		case "replace":
+			if old, nw, ok := parseReplace(rest); ok {
+				mf.replace[old.path] = nw
+			}
+		}
+	}
+	return mf, sc.Err()
+}
+
+func parseModuleVersion(s string) (module, bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return module{}, false
+	}
+	return module{path: fields[0], version: fields[1]}, true
+}
+
+// parseReplace handles both forms of a replace directive:
+//
+//	old[@version] => new version
+//	old[@version] => ../local/path
+func parseReplace(s string) (old, nw module, ok bool) {
+	parts := strings.SplitN(s, "=>", 2)
+	if len(parts) != 2 {
+		return
+	}
+	old, ok = parseModuleVersion(strings.TrimSpace(parts[0]))
+	if !ok {
+		// no version pinned on the left-hand side
+		fields := strings.Fields(strings.TrimSpace(parts[0]))
+		if len(fields) == 0 {
+			// blank left-hand side, e.g. a stray "=> ../local" line; not a
+			// directive we can act on.
+			return module{}, module{}, false
+		}
+		old = module{path: fields[0]}
+		ok = old.path != ""
+	}
+	rhs := strings.TrimSpace(parts[1])
+	if nw, ok2 := parseModuleVersion(rhs); ok2 {
+		return old, nw, ok
+	}
+	// local filesystem replacement: no version.
+	return old, module{path: rhs}, ok && rhs != ""
+}
+
+// resolveModule finds the module providing path, according to the go.mod
+// rooted at rootdir, and returns the directory its sources live in. It
+// checks the main module first, then require/replace directives, falling
+// back to $GOPATH/pkg/mod/<module>@<version> and downloading the module via
+// "go mod download" if it isn't in the cache yet.
+func resolveModule(rootdir, path string) (dir string, ok bool) {
+	mf, err := loadModFile(filepath.Join(rootdir, "go.mod"))
+	if err != nil || mf == nil {
+		return "", false
+	}
+
+	if mf.module != "" && (path == mf.module || strings.HasPrefix(path, mf.module+"/")) {
+		rel := strings.TrimPrefix(strings.TrimPrefix(path, mf.module), "/")
+		return filepath.Join(rootdir, rel), true
+	}
+
+	mod, sub, found := longestPrefixModule(mf.require, path)
+	if !found {
+		return "", false
+	}
+
+	if rep, ok := mf.replace[mod.path]; ok {
+		if rep.version == "" {
+			base := rep.path
+			if !filepath.IsAbs(base) {
+				base = filepath.Join(rootdir, base)
+			}
+			return filepath.Join(base, sub), true
+		}
+		mod = rep
+	}
+
+	cacheDir := filepath.Join(gopath(), "pkg", "mod", escapeModule(mod.path)+"@"+mod.version)
+	if _, err := os.Stat(cacheDir); err != nil {
+		if err := downloadModule(mod); err != nil {
+			reportf("go mod download failed for %s@%s: %v\n", mod.path, mod.version, err)
+			return "", false
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, sub)); err != nil {
+		return "", false
+	}
+	verifyGoSum(rootdir, mod)
+	return filepath.Join(cacheDir, sub), true
+}
+
+// longestPrefixModule returns the required module whose path is the longest
+// prefix of the import path, along with the remaining package sub-path
+// inside that module.
+func longestPrefixModule(require []module, path string) (mod module, sub string, ok bool) {
+	for _, m := range require {
+		if path != m.path && !strings.HasPrefix(path, m.path+"/") {
+			continue
+		}
+		if len(m.path) > len(mod.path) {
+			mod = m
+			ok = true
+		}
+	}
+	if !ok {
+		return module{}, "", false
+	}
+	sub = strings.TrimPrefix(strings.TrimPrefix(path, mod.path), "/")
+	return mod, sub, true
+}
+
+// downloadModule shells out to "go mod download" to populate the module
+// cache for a dependency that loadSources/loadDependencies needs but that
+// isn't on disk yet.
+func downloadModule(mod module) error {
+	reportf("downloading %s@%s\n", mod.path, mod.version)
+	cmd := exec.Command("go", "mod", "download", "-json", mod.path+"@"+mod.version)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// verifyGoSum checks that go.sum, if present, records an entry for mod. It
+// only reports a mismatch; golo doesn't re-implement the hash itself since
+// "go mod download" already verified it against GONOSUMCHECK/GOSUMDB.
+func verifyGoSum(rootdir string, mod module) {
+	f, err := os.Open(filepath.Join(rootdir, "go.sum"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	want := mod.path + " " + mod.version
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if strings.HasPrefix(sc.Text(), want) {
+			return
+		}
+	}
+	reportf("warning: %s@%s has no go.sum entry\n", mod.path, mod.version)
+}
+
+// escapeModule applies the module-cache "!" escaping go uses for uppercase
+// letters in module paths (e.g. "BurntSushi" -> "!burnt!sushi").
+func escapeModule(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			b.WriteRune(r + ('a' - 'A'))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func gopath() string {
+	if gp := os.Getenv("GOPATH"); gp != "" {
+		return strings.SplitN(gp, string(filepath.ListSeparator), 2)[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "go")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseReplace(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantOld module
+		wantNew module
+		wantOK  bool
+	}{
+		{
+			name:    "versioned to versioned",
+			line:    "example.com/old v1.0.0 => example.com/new v1.2.3",
+			wantOld: module{path: "example.com/old", version: "v1.0.0"},
+			wantNew: module{path: "example.com/new", version: "v1.2.3"},
+			wantOK:  true,
+		},
+		{
+			name:    "unversioned to local path",
+			line:    "example.com/old => ../local",
+			wantOld: module{path: "example.com/old"},
+			wantNew: module{path: "../local"},
+			wantOK:  true,
+		},
+		{
+			name:    "versioned to local path",
+			line:    "example.com/old v1.0.0 => ../local",
+			wantOld: module{path: "example.com/old", version: "v1.0.0"},
+			wantNew: module{path: "../local"},
+			wantOK:  true,
+		},
+		{
+			name:   "no arrow",
+			line:   "example.com/old v1.0.0",
+			wantOK: false,
+		},
+		{
+			name:   "blank left-hand side",
+			line:   "=> ../local",
+			wantOK: false,
+		},
+		{
+			name:   "blank left-hand side inside a block",
+			line:   "   => ../local",
+			wantOK: false,
+		},
+		{
+			name:   "blank right-hand side",
+			line:   "example.com/old =>",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, nw, ok := parseReplace(tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("parseReplace(%q) ok = %v, want %v", tt.line, ok, tt.wantOK)
+			}
+			if !tt.wantOK {
+				return
+			}
+			if old != tt.wantOld {
+				t.Errorf("parseReplace(%q) old = %+v, want %+v", tt.line, old, tt.wantOld)
+			}
+			if nw != tt.wantNew {
+				t.Errorf("parseReplace(%q) new = %+v, want %+v", tt.line, nw, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestLoadModFile(t *testing.T) {
+	dir := t.TempDir()
+	goMod := `module example.com/app
+
+go 1.21
+
+require (
+	example.com/foo v1.0.0
+	example.com/bar v2.3.4
+)
+
+replace example.com/foo => ../vendored-foo
+
+replace example.com/bar v2.3.4 => example.com/bar-fork v2.3.5-patched
+
+exclude example.com/bar v2.0.0
+`
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mf, err := loadModFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatalf("loadModFile: %v", err)
+	}
+	if mf.module != "example.com/app" {
+		t.Errorf("module = %q, want example.com/app", mf.module)
+	}
+	if len(mf.require) != 2 {
+		t.Fatalf("require = %v, want 2 entries", mf.require)
+	}
+	if rep := mf.replace["example.com/foo"]; rep != (module{path: "../vendored-foo"}) {
+		t.Errorf("replace[foo] = %+v, want local path replacement", rep)
+	}
+	if rep := mf.replace["example.com/bar"]; rep != (module{path: "example.com/bar-fork", version: "v2.3.5-patched"}) {
+		t.Errorf("replace[bar] = %+v, want versioned replacement", rep)
+	}
+	if !mf.exclude["example.com/bar@v2.0.0"] {
+		t.Errorf("exclude missing example.com/bar@v2.0.0")
+	}
+}
+
+func TestLoadModFileMissing(t *testing.T) {
+	mf, err := loadModFile(filepath.Join(t.TempDir(), "go.mod"))
+	if err != nil {
+		t.Fatalf("loadModFile on missing file returned error: %v", err)
+	}
+	if mf != nil {
+		t.Fatalf("loadModFile on missing file = %+v, want nil", mf)
+	}
+}
+
+func TestResolveModuleMainModule(t *testing.T) {
+	dir := t.TempDir()
+	goMod := "module example.com/app\n\ngo 1.21\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "internal", "util"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := resolveModule(dir, "example.com/app/internal/util")
+	if !ok {
+		t.Fatalf("resolveModule did not resolve a main-module package")
+	}
+	if want := filepath.Join(dir, "internal", "util"); got != want {
+		t.Errorf("resolveModule = %q, want %q", got, want)
+	}
+}
+
+func TestResolveModuleLocalReplace(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "fork")
+	if err := os.MkdirAll(filepath.Join(local, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	goMod := `module example.com/app
+
+go 1.21
+
+require example.com/dep v1.0.0
+
+replace example.com/dep => ./fork
+`
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := resolveModule(dir, "example.com/dep/sub")
+	if !ok {
+		t.Fatalf("resolveModule did not resolve a locally-replaced package")
+	}
+	if want := filepath.Join(local, "sub"); got != want {
+		t.Errorf("resolveModule = %q, want %q", got, want)
+	}
+}
+
+func TestResolveModuleAbsoluteLocalReplace(t *testing.T) {
+	dir := t.TempDir()
+	fork := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(fork, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	goMod := "module example.com/app\n\ngo 1.21\n\nrequire example.com/dep v1.0.0\n\nreplace example.com/dep => " + fork + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := resolveModule(dir, "example.com/dep/sub")
+	if !ok {
+		t.Fatalf("resolveModule did not resolve an absolute local replacement")
+	}
+	if want := filepath.Join(fork, "sub"); got != want {
+		t.Errorf("resolveModule = %q, want %q (must not be nested under rootdir)", got, want)
+	}
+}
+
+func TestResolveModuleNoGoMod(t *testing.T) {
+	if _, ok := resolveModule(t.TempDir(), "example.com/app"); ok {
+		t.Fatalf("resolveModule resolved a path with no go.mod present")
+	}
+}
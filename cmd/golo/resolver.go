@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/tools/go/vcs"
+)
+
+// resolver.go replaces the ad-hoc load/register closures that used to live
+// in loadDependencies with a small chain of Resolver implementations, each
+// responsible for one source of truth. The chain is tried in order and the
+// first resolver to recognize an import path wins.
+
+// Resolver locates the directory holding the sources for an import path.
+type Resolver interface {
+	Resolve(path string) (dir string, ok bool)
+}
+
+// resolverFunc adapts a plain function to a Resolver.
+type resolverFunc func(string) (string, bool)
+
+func (f resolverFunc) Resolve(path string) (string, bool) { return f(path) }
+
+// resolverChain tries each Resolver in turn, returning the first hit.
+type resolverChain []Resolver
+
+func (c resolverChain) Resolve(path string) (string, bool) {
+	for _, r := range c {
+		if dir, ok := r.Resolve(path); ok {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// newResolverChain builds the standard golo resolver chain: GOROOT, vendor,
+// the module cache (go.mod-aware, see gomod.go), and, unless offline is set,
+// a network resolver that clones missing repositories on demand.
+func newResolverChain(rootdir string, offline bool) resolverChain {
+	chain := resolverChain{
+		gorootResolver{},
+		vendorResolver{rootdir: rootdir},
+		resolverFunc(func(path string) (string, bool) { return resolveModule(rootdir, path) }),
+	}
+	if !offline {
+		chain = append(chain, newNetworkResolver(rootdir))
+	}
+	return chain
+}
+
+// gorootResolver finds standard library packages under GOROOT/src.
+type gorootResolver struct{}
+
+func (gorootResolver) Resolve(path string) (string, bool) {
+	dir := filepath.Join(runtime.GOROOT(), "src", path)
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// vendorResolver finds packages in the project's top-level vendor/ tree.
+type vendorResolver struct {
+	rootdir string
+}
+
+func (v vendorResolver) Resolve(path string) (string, bool) {
+	dir := filepath.Join(v.rootdir, "vendor", path)
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// networkResolver resolves an import path by cloning its repository into
+// .golo/cache/<sha1> (the tree cacheDir already hashes paths into), using
+// golang.org/x/tools/go/vcs to figure out where and how to fetch it. Repo
+// revisions can be pinned via a golo.toml manifest at the project root.
+type networkResolver struct {
+	rootdir string
+	pins    map[string]string
+}
+
+func newNetworkResolver(rootdir string) *networkResolver {
+	pins, err := loadGoloToml(filepath.Join(rootdir, "golo.toml"))
+	if err != nil {
+		reportf("warning: could not read golo.toml: %v\n", err)
+	}
+	return &networkResolver{rootdir: rootdir, pins: pins}
+}
+
+func (n *networkResolver) Resolve(path string) (string, bool) {
+	root, err := vcs.RepoRootForImportPath(path, verbose)
+	if err != nil {
+		return "", false
+	}
+
+	dest := cacheDir(n.rootdir, root.Root)
+	if _, err := os.Stat(dest); err != nil {
+		reportf("cloning %s into %s\n", root.Repo, dest)
+		if err := root.VCS.Create(dest, root.Repo); err != nil {
+			reportf("warning: cannot clone %s: %v\n", root.Repo, err)
+			return "", false
+		}
+	}
+
+	if rev, ok := n.pins[root.Root]; ok {
+		if err := root.VCS.TagSync(dest, rev); err != nil {
+			reportf("warning: cannot sync %s to %s: %v\n", root.Root, rev, err)
+		}
+	}
+
+	sub := strings.TrimPrefix(strings.TrimPrefix(path, root.Root), "/")
+	dir := filepath.Join(dest, sub)
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// loadGoloToml reads the "[dependencies]" table of the optional golo.toml
+// manifest, mapping each pinned import root to a branch, tag or commit. It's
+// a deliberately tiny TOML subset - golo has no toml dependency to reach
+// for - so only simple `"import/path" = "revision"` lines are understood.
+func loadGoloToml(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	pins := make(map[string]string)
+	section := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		if section != "dependencies" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.Trim(strings.TrimSpace(parts[0]), `"`)
+		val := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		pins[key] = val
+	}
+	return pins, sc.Err()
+}
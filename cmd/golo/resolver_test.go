@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadGoloToml(t *testing.T) {
+	dir := t.TempDir()
+	toml := `# pinned revisions
+[dependencies]
+"example.com/foo" = "v1.2.3"
+"example.com/bar" = "deadbeef"
+
+[other]
+"example.com/ignored" = "nope"
+`
+	if err := os.WriteFile(filepath.Join(dir, "golo.toml"), []byte(toml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pins, err := loadGoloToml(filepath.Join(dir, "golo.toml"))
+	if err != nil {
+		t.Fatalf("loadGoloToml: %v", err)
+	}
+	want := map[string]string{
+		"example.com/foo": "v1.2.3",
+		"example.com/bar": "deadbeef",
+	}
+	if len(pins) != len(want) {
+		t.Fatalf("pins = %v, want %v", pins, want)
+	}
+	for k, v := range want {
+		if pins[k] != v {
+			t.Errorf("pins[%q] = %q, want %q", k, pins[k], v)
+		}
+	}
+}
+
+func TestLoadGoloTomlMissing(t *testing.T) {
+	pins, err := loadGoloToml(filepath.Join(t.TempDir(), "golo.toml"))
+	if err != nil {
+		t.Fatalf("loadGoloToml on missing file returned error: %v", err)
+	}
+	if pins != nil {
+		t.Fatalf("loadGoloToml on missing file = %v, want nil", pins)
+	}
+}
+
+func TestGorootResolver(t *testing.T) {
+	r := gorootResolver{}
+
+	// "fmt" is always present under GOROOT/src in any working Go install.
+	dir, ok := r.Resolve("fmt")
+	if !ok {
+		t.Fatalf("gorootResolver did not resolve the standard library's fmt package")
+	}
+	if filepath.Base(dir) != "fmt" {
+		t.Errorf("gorootResolver.Resolve(\"fmt\") = %q, want a path ending in .../fmt", dir)
+	}
+
+	if _, ok := r.Resolve("example.com/definitely-not-in-goroot"); ok {
+		t.Errorf("gorootResolver resolved a package that doesn't exist")
+	}
+}
+
+func TestVendorResolver(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "vendor", "example.com/pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := vendorResolver{rootdir: root}
+	dir, ok := r.Resolve("example.com/pkg")
+	if !ok {
+		t.Fatalf("vendorResolver did not resolve a vendored package")
+	}
+	if want := filepath.Join(root, "vendor", "example.com/pkg"); dir != want {
+		t.Errorf("vendorResolver.Resolve = %q, want %q", dir, want)
+	}
+	if _, ok := r.Resolve("example.com/missing"); ok {
+		t.Errorf("vendorResolver resolved a package that isn't vendored")
+	}
+}
+
+func TestResolverChain(t *testing.T) {
+	miss := resolverFunc(func(string) (string, bool) { return "", false })
+	hit := resolverFunc(func(path string) (string, bool) { return "/found/" + path, true })
+
+	chain := resolverChain{miss, hit, resolverFunc(func(string) (string, bool) {
+		t.Fatal("resolverChain called a resolver after one already matched")
+		return "", false
+	})}
+
+	dir, ok := chain.Resolve("example.com/pkg")
+	if !ok || dir != "/found/example.com/pkg" {
+		t.Errorf("resolverChain.Resolve = (%q, %v), want (\"/found/example.com/pkg\", true)", dir, ok)
+	}
+
+	empty := resolverChain{miss, miss}
+	if _, ok := empty.Resolve("example.com/pkg"); ok {
+		t.Errorf("resolverChain resolved when every resolver missed")
+	}
+}